@@ -3,12 +3,19 @@ package controller
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"net"
+	"sort"
+	"strings"
 	"text/template"
+	"time"
 
 	"github.com/openshift/cluster-dns-operator/pkg/manifests"
 
+	"github.com/openshift/library-go/pkg/operator/configobserver/featuregates"
+
 	"github.com/sirupsen/logrus"
 
 	"github.com/google/go-cmp/cmp"
@@ -24,16 +31,47 @@ import (
 
 const resolvConf = "/etc/resolv.conf"
 
+// featureGateDNSOverQUIC gates the QUIC upstream protocol while the
+// underlying CoreDNS QUIC forwarder is still maturing upstream.
+const featureGateDNSOverQUIC = featuregates.Feature("DNSOverQUIC")
+
 var errInvalidNetworkUpstream = fmt.Errorf("The address field is mandatory for upstream of type Network, but was not provided")
+var errInvalidProtocolForSystemUpstream = fmt.Errorf("the TLS, HTTPS, and QUIC protocols are only valid for upstreams of type Network")
+var errQUICProtocolNotEnabled = fmt.Errorf("the QUIC protocol requires the %s feature gate to be enabled", featureGateDNSOverQUIC)
 var corefileTemplate = template.Must(template.New("Corefile").Funcs(template.FuncMap{
-	"CoreDNSForwardingPolicy": coreDNSPolicy, "UpstreamResolver": coreDNSResolver,
+	"CoreDNSForwardingPolicy": coreDNSPolicy, "UpstreamResolver": coreDNSResolver, "ForwardOptions": coreDNSForwardOptions,
+	"EffectiveCachePolicy": effectiveCachePolicy, "CachePolicyBlock": coreDNSCachePolicy,
+	"FilteringBlock": coreDNSFilteringBlock, "LocalRecordsBlock": coreDNSLocalRecordsBlock,
 }).Parse(`{{range .Servers -}}
 # {{.Name}}
 {{range .Zones}}{{.}}:5353 {{end}}{
     {{with .ForwardPlugin -}}
     prometheus 127.0.0.1:9153
-    forward .{{range .Upstreams}} {{.}}{{end}} {
+    forward .{{range .Upstreams}} {{UpstreamResolver .}}{{end}} {
         policy {{ CoreDNSForwardingPolicy .Policy }}
+        {{- with ForwardOptions .Upstreams }}
+        {{- if .TLSServerName }}
+        tls_servername {{.TLSServerName}}
+        {{- end}}
+        {{- if .ForceTCP }}
+        force_tcp
+        {{- end}}
+        {{- if .PreferUDP }}
+        prefer_udp
+        {{- end}}
+        {{- if .HealthCheckIntervalSeconds }}
+        health_check {{.HealthCheckIntervalSeconds}}s
+        {{- end}}
+        {{- if .MaxFails }}
+        max_fails {{.MaxFails}}
+        {{- end}}
+        {{- if .ExpireSeconds }}
+        expire {{.ExpireSeconds}}s
+        {{- end}}
+        {{- if .FailfastAllUnhealthyUpstreams }}
+        failfast_all_unhealthy_upstreams
+        {{- end}}
+        {{- end}}
     }
     {{- end}}
     errors
@@ -41,9 +79,9 @@ var corefileTemplate = template.Must(template.New("Corefile").Funcs(template.Fun
         {{$.LogLevel}}
     }
     bufsize 512
-    cache 900 {
-        denial 9984 30
-    }
+    {{- with CachePolicyBlock (EffectiveCachePolicy .CachePolicy $.CachePolicy) }}
+    {{.}}
+    {{- end}}
 }
 {{end -}}
 .:5353 {
@@ -61,44 +99,98 @@ var corefileTemplate = template.Must(template.New("Corefile").Funcs(template.Fun
         fallthrough in-addr.arpa ip6.arpa
     }
     prometheus 127.0.0.1:9153
+    {{- with LocalRecordsBlock .LocalRecords .LocalRecordsFilePath }}
+    {{.}}
+    {{- end}}
+    {{- with FilteringBlock .Filtering .FilterListPath .FilterMatchRegex }}
+    {{.}}
+    {{- end}}
 	{{- with .UpstreamResolvers }}
     forward .{{range .Upstreams}} {{UpstreamResolver .}}{{end}} {
         policy {{ CoreDNSForwardingPolicy .Policy }}
+        {{- with ForwardOptions .Upstreams }}
+        {{- if .TLSServerName }}
+        tls_servername {{.TLSServerName}}
+        {{- end}}
+        {{- if .ForceTCP }}
+        force_tcp
+        {{- end}}
+        {{- if .PreferUDP }}
+        prefer_udp
+        {{- end}}
+        {{- if .HealthCheckIntervalSeconds }}
+        health_check {{.HealthCheckIntervalSeconds}}s
+        {{- end}}
+        {{- if .MaxFails }}
+        max_fails {{.MaxFails}}
+        {{- end}}
+        {{- if .ExpireSeconds }}
+        expire {{.ExpireSeconds}}s
+        {{- end}}
+        {{- if .FailfastAllUnhealthyUpstreams }}
+        failfast_all_unhealthy_upstreams
+        {{- end}}
+        {{- end}}
     }
 	{{- end}}
-    cache 900 {
-        denial 9984 30
-    }
+    {{- with CachePolicyBlock .CachePolicy }}
+    {{.}}
+    {{- end}}
     reload
 }
 `))
 
-// ensureDNSConfigMap ensures that a configmap exists for a given DNS.
-func (r *reconciler) ensureDNSConfigMap(dns *operatorv1.DNS, clusterDomain string) (bool, *corev1.ConfigMap, error) {
+// forwardOptions holds the CoreDNS forward plugin options that apply to an
+// entire forward block rather than to a single upstream, because CoreDNS
+// only accepts one of each per `forward` instance.
+type forwardOptions struct {
+	TLSServerName                 string
+	ForceTCP                      bool
+	PreferUDP                     bool
+	HealthCheckIntervalSeconds    int32
+	MaxFails                      int32
+	ExpireSeconds                 int32
+	FailfastAllUnhealthyUpstreams bool
+}
+
+// ensureDNSConfigMap ensures that a configmap exists for a given DNS. The
+// returned duration is how long the caller should wait before requeuing to
+// pick up a periodic Spec.Filtering source refresh.
+func (r *reconciler) ensureDNSConfigMap(dns *operatorv1.DNS, clusterDomain string) (bool, *corev1.ConfigMap, time.Duration, error) {
 	haveCM, current, err := r.currentDNSConfigMap(dns)
 	if err != nil {
-		return false, nil, fmt.Errorf("failed to get configmap: %v", err)
+		return false, nil, 0, fmt.Errorf("failed to get configmap: %v", err)
+	}
+	haveFilterListCM, filterListCM, filterListRequeueAfter, err := r.ensureFilterListConfigMap(dns)
+	if err != nil {
+		return false, nil, filterListRequeueAfter, fmt.Errorf("failed to ensure filter list configmap: %v", err)
+	}
+	var filterListRegex string
+	if filterListCM != nil {
+		filterListRegex = filterListCM.Data[filterListRegexDataKey]
 	}
-	desired, err := desiredDNSConfigMap(dns, clusterDomain)
+	desired, err := desiredDNSConfigMap(dns, clusterDomain, r.FeatureGates.Enabled(featureGateDNSOverQUIC), haveFilterListCM, filterListRegex)
 	if err != nil {
-		return haveCM, current, fmt.Errorf("failed to build configmap: %v", err)
+		return haveCM, current, filterListRequeueAfter, fmt.Errorf("failed to build configmap: %v", err)
 	}
 
 	switch {
 	case !haveCM:
 		if err := r.client.Create(context.TODO(), desired); err != nil {
-			return false, nil, fmt.Errorf("failed to create configmap: %v", err)
+			return false, nil, filterListRequeueAfter, fmt.Errorf("failed to create configmap: %v", err)
 		}
 		logrus.Infof("created configmap: %s", desired.Name)
-		return r.currentDNSConfigMap(dns)
+		haveCM, current, err = r.currentDNSConfigMap(dns)
+		return haveCM, current, filterListRequeueAfter, err
 	case haveCM:
 		if updated, err := r.updateDNSConfigMap(current, desired); err != nil {
-			return true, current, err
+			return true, current, filterListRequeueAfter, err
 		} else if updated {
-			return r.currentDNSConfigMap(dns)
+			haveCM, current, err = r.currentDNSConfigMap(dns)
+			return haveCM, current, filterListRequeueAfter, err
 		}
 	}
-	return true, current, nil
+	return true, current, filterListRequeueAfter, nil
 }
 
 func (r *reconciler) currentDNSConfigMap(dns *operatorv1.DNS) (bool, *corev1.ConfigMap, error) {
@@ -113,7 +205,13 @@ func (r *reconciler) currentDNSConfigMap(dns *operatorv1.DNS) (bool, *corev1.Con
 	return true, current, nil
 }
 
-func desiredDNSConfigMap(dns *operatorv1.DNS, clusterDomain string) (*corev1.ConfigMap, error) {
+// desiredDNSConfigMap builds the Corefile for dns. haveFilterListCM reports
+// whether ensureFilterListConfigMap currently has a filter-list ConfigMap
+// backing Spec.Filtering (it is false when filtering is off, or when the
+// filterListDisabledAnnotation kill-switch has just deleted it) — the
+// rendered filtering block is suppressed in that case so the Corefile never
+// references a hosts file or match regex that doesn't exist.
+func desiredDNSConfigMap(dns *operatorv1.DNS, clusterDomain string, quicEnabled bool, haveFilterListCM bool, filterListRegex string) (*corev1.ConfigMap, error) {
 	if len(clusterDomain) == 0 {
 		clusterDomain = "cluster.local"
 	}
@@ -129,29 +227,63 @@ func desiredDNSConfigMap(dns *operatorv1.DNS, clusterDomain string) (*corev1.Con
 
 	if len(dns.Spec.UpstreamResolvers.Upstreams) > 0 {
 		upstreamResolvers.Upstreams = dns.Spec.UpstreamResolvers.Upstreams
-		for _, upstream := range upstreamResolvers.Upstreams {
-			if upstream.Type == operatorv1.NetworkResolverType && upstream.Address == "" {
-				return nil, errInvalidNetworkUpstream
-			}
-		}
 	}
 
 	if dns.Spec.UpstreamResolvers.Policy != "" {
 		upstreamResolvers.Policy = dns.Spec.UpstreamResolvers.Policy
 	}
 
+	if err := validateUpstreams(upstreamResolvers.Upstreams, quicEnabled); err != nil {
+		return nil, err
+	}
+	if err := validateCachePolicy(dns.Spec.CachePolicy); err != nil {
+		return nil, err
+	}
+	if err := validateLocalRecords(dns.Spec.LocalRecords, clusterDomain); err != nil {
+		return nil, err
+	}
+	for _, server := range dns.Spec.Servers {
+		if server.ForwardPlugin.Upstreams != nil {
+			if err := validateUpstreams(server.ForwardPlugin.Upstreams, quicEnabled); err != nil {
+				return nil, err
+			}
+		}
+		if server.CachePolicy != nil {
+			if err := validateCachePolicy(*server.CachePolicy); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	filtering := dns.Spec.Filtering
+	if !haveFilterListCM {
+		filtering.Enabled = false
+	}
+
 	corefileParameters := struct {
-		ClusterDomain     string
-		Servers           interface{}
-		UpstreamResolvers operatorv1.UpstreamResolvers
-		PolicyStr         func(policy operatorv1.ForwardingPolicy) string
-		LogLevel          string
+		ClusterDomain        string
+		Servers              interface{}
+		UpstreamResolvers    operatorv1.UpstreamResolvers
+		PolicyStr            func(policy operatorv1.ForwardingPolicy) string
+		LogLevel             string
+		CachePolicy          operatorv1.CachePolicy
+		Filtering            operatorv1.DNSFiltering
+		FilterListPath       string
+		FilterMatchRegex     string
+		LocalRecords         operatorv1.LocalRecordsSpec
+		LocalRecordsFilePath string
 	}{
-		ClusterDomain:     clusterDomain,
-		Servers:           dns.Spec.Servers,
-		UpstreamResolvers: upstreamResolvers,
-		PolicyStr:         coreDNSPolicy,
-		LogLevel:          coreDNSLogLevel(dns),
+		ClusterDomain:        clusterDomain,
+		Servers:              dns.Spec.Servers,
+		UpstreamResolvers:    upstreamResolvers,
+		PolicyStr:            coreDNSPolicy,
+		LogLevel:             coreDNSLogLevel(dns),
+		CachePolicy:          dns.Spec.CachePolicy,
+		Filtering:            filtering,
+		FilterListPath:       filterListHostsMountPath,
+		FilterMatchRegex:     filterListRegex,
+		LocalRecords:         dns.Spec.LocalRecords,
+		LocalRecordsFilePath: localRecordsZonefileMountPath,
 	}
 	corefile := new(bytes.Buffer)
 	if err := corefileTemplate.Execute(corefile, corefileParameters); err != nil {
@@ -171,6 +303,9 @@ func desiredDNSConfigMap(dns *operatorv1.DNS, clusterDomain string) (*corev1.Con
 			"Corefile": corefile.String(),
 		},
 	}
+	if len(dns.Spec.LocalRecords.Records) > 0 {
+		cm.Data[localRecordsZonefileDataKey] = buildLocalRecordsZonefile(dns.Spec.LocalRecords)
+	}
 	cm.SetOwnerReferences([]metav1.OwnerReference{dnsOwnerRef(dns)})
 
 	return cm, nil
@@ -200,18 +335,344 @@ func corefileChanged(current, expected *corev1.ConfigMap) (bool, *corev1.ConfigM
 	return true, updated
 }
 
+// validateUpstreams rejects upstream configurations that the Corefile
+// generator cannot render, so that desiredDNSConfigMap fails fast with a
+// clear error instead of propagating a template execution error.
+func validateUpstreams(upstreams []operatorv1.Upstream, quicEnabled bool) error {
+	for _, upstream := range upstreams {
+		if upstream.Type == operatorv1.NetworkResolverType && upstream.Address == "" {
+			return errInvalidNetworkUpstream
+		}
+		if upstream.Type != operatorv1.NetworkResolverType && upstream.Protocol != "" && upstream.Protocol != operatorv1.UDPProtocol && upstream.Protocol != operatorv1.TCPProtocol {
+			return errInvalidProtocolForSystemUpstream
+		}
+		if upstream.Protocol == operatorv1.QUICProtocol && !quicEnabled {
+			return errQUICProtocolNotEnabled
+		}
+	}
+	if _, err := coreDNSForwardOptions(upstreams); err != nil {
+		return err
+	}
+	return nil
+}
+
+const (
+	defaultCachePositiveTTLSeconds = 900
+	defaultCacheNegativeTTLSeconds = 30
+	defaultCacheMaxNegativeEntries = 9984
+	defaultCachePrefetchDuration   = "1m"
+)
+
+// effectiveCachePolicy returns the per-server cache policy override when one
+// is set, and falls back to the cluster-wide policy otherwise.
+func effectiveCachePolicy(serverPolicy *operatorv1.CachePolicy, globalPolicy operatorv1.CachePolicy) operatorv1.CachePolicy {
+	if serverPolicy != nil {
+		return *serverPolicy
+	}
+	return globalPolicy
+}
+
+// validateCachePolicy rejects cache policies that the Corefile generator
+// cannot render.
+func validateCachePolicy(policy operatorv1.CachePolicy) error {
+	if policy.PositiveTTLSeconds < 0 {
+		return fmt.Errorf("cache policy positiveTTLSeconds must not be negative")
+	}
+	if policy.NegativeTTLSeconds < 0 {
+		return fmt.Errorf("cache policy negativeTTLSeconds must not be negative")
+	}
+	if policy.MaxPositiveEntries < 0 {
+		return fmt.Errorf("cache policy maxPositiveEntries must not be negative")
+	}
+	if policy.MaxNegativeEntries < 0 {
+		return fmt.Errorf("cache policy maxNegativeEntries must not be negative")
+	}
+	if prefetch := policy.Prefetch; prefetch != nil {
+		if prefetch.Amount < 0 {
+			return fmt.Errorf("cache policy prefetch amount must not be negative")
+		}
+		if prefetch.Percentage < 0 || prefetch.Percentage > 100 {
+			return fmt.Errorf("cache policy prefetch percentage must be between 0 and 100")
+		}
+		if prefetch.Duration != "" {
+			if _, err := time.ParseDuration(prefetch.Duration); err != nil {
+				return fmt.Errorf("cache policy prefetch duration is invalid: %v", err)
+			}
+		}
+	}
+	if serveStale := policy.ServeStale; serveStale != nil && serveStale.Duration != "" {
+		if _, err := time.ParseDuration(serveStale.Duration); err != nil {
+			return fmt.Errorf("cache policy serve_stale duration is invalid: %v", err)
+		}
+	}
+	return nil
+}
+
+// coreDNSCachePolicy renders a CachePolicy as a complete CoreDNS `cache`
+// plugin block, indented to match the surrounding server block, or an empty
+// string if caching is disabled. Zero-valued fields fall back to the values
+// this operator used to hardcode, so that an unset CachePolicy behaves exactly as
+// the previously hardcoded `cache 900 { denial 9984 30 }` did. A Prefetch
+// with no Duration falls back to defaultCachePrefetchDuration, since the
+// `prefetch` directive requires all three tokens.
+func coreDNSCachePolicy(policy operatorv1.CachePolicy) (string, error) {
+	if policy.Disabled {
+		return "", nil
+	}
+	if err := validateCachePolicy(policy); err != nil {
+		return "", err
+	}
+
+	positiveTTL := policy.PositiveTTLSeconds
+	if positiveTTL == 0 {
+		positiveTTL = defaultCachePositiveTTLSeconds
+	}
+	negativeTTL := policy.NegativeTTLSeconds
+	if negativeTTL == 0 {
+		negativeTTL = defaultCacheNegativeTTLSeconds
+	}
+	maxNegativeEntries := policy.MaxNegativeEntries
+	if maxNegativeEntries == 0 {
+		maxNegativeEntries = defaultCacheMaxNegativeEntries
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "cache %d {\n", positiveTTL)
+	if policy.MaxPositiveEntries > 0 {
+		fmt.Fprintf(&b, "        success %d\n", policy.MaxPositiveEntries)
+	}
+	fmt.Fprintf(&b, "        denial %d %d\n", maxNegativeEntries, negativeTTL)
+	if prefetch := policy.Prefetch; prefetch != nil {
+		prefetchDuration := prefetch.Duration
+		if prefetchDuration == "" {
+			prefetchDuration = defaultCachePrefetchDuration
+		}
+		fmt.Fprintf(&b, "        prefetch %d %s %d%%\n", prefetch.Amount, prefetchDuration, prefetch.Percentage)
+	}
+	if serveStale := policy.ServeStale; serveStale != nil {
+		fmt.Fprintf(&b, "        serve_stale %s\n", serveStale.Duration)
+	}
+	b.WriteString("    }")
+	return b.String(), nil
+}
+
+// coreDNSFilteringBlock renders Spec.Filtering as a CoreDNS plugin block
+// that runs ahead of the forward plugin, or an empty string when filtering
+// is off or has no sources yet. ZEROIP responses are served straight from
+// the hosts file the filter-list reconciler maintains; NXDOMAIN/REFUSED
+// responses go through the template plugin against the same list compiled
+// into a single match regex.
+func coreDNSFilteringBlock(filtering operatorv1.DNSFiltering, hostsPath, matchRegex string) (string, error) {
+	if !filtering.Enabled || len(filtering.Sources) == 0 {
+		return "", nil
+	}
+	switch filtering.BlockResponse {
+	case operatorv1.FilteringBlockResponseZeroIP, "":
+		return fmt.Sprintf("hosts %s {\n        fallthrough\n    }", hostsPath), nil
+	case operatorv1.FilteringBlockResponseNXDOMAIN, operatorv1.FilteringBlockResponseRefused:
+		if matchRegex == "" {
+			return "", nil
+		}
+		rcode := "NXDOMAIN"
+		if filtering.BlockResponse == operatorv1.FilteringBlockResponseRefused {
+			rcode = "REFUSED"
+		}
+		return fmt.Sprintf("template IN ANY {\n        match %s\n        rcode %s\n        fallthrough\n    }", matchRegex, rcode), nil
+	}
+	return "", fmt.Errorf("unsupported filtering block response %q", filtering.BlockResponse)
+}
+
+const (
+	localRecordsZonefileDataKey   = "LocalRecords.zone"
+	localRecordsZonefileMountPath = "/etc/coredns/local-records/db.zone"
+)
+
+// validateLocalRecords rejects a LocalRecordsSpec that the Corefile
+// generator cannot safely render: a missing zone, non-FQDN names, records
+// outside the declared zone, an unsupported record type, duplicate
+// name/type pairs, and CNAMEs that would shadow the cluster's own DNS
+// domain.
+func validateLocalRecords(spec operatorv1.LocalRecordsSpec, clusterDomain string) error {
+	if len(spec.Records) == 0 {
+		return nil
+	}
+	zone := strings.ToLower(spec.Zone)
+	if !strings.HasSuffix(zone, ".") {
+		return fmt.Errorf("local records zone %q must be a fully qualified domain name ending in \".\"", spec.Zone)
+	}
+	if zone == clusterDomain+"." {
+		return fmt.Errorf("local records zone %q must not be the cluster domain", spec.Zone)
+	}
+
+	seen := map[string]struct{}{}
+	for _, record := range spec.Records {
+		name := strings.ToLower(record.Name)
+		if !strings.HasSuffix(name, ".") {
+			return fmt.Errorf("local record %q must be a fully qualified domain name ending in \".\"", record.Name)
+		}
+		if name != zone && !strings.HasSuffix(name, "."+zone) {
+			return fmt.Errorf("local record %q is not in zone %q", record.Name, spec.Zone)
+		}
+		switch record.Type {
+		case operatorv1.ALocalRecordType, operatorv1.AAAALocalRecordType, operatorv1.CNAMELocalRecordType, operatorv1.SRVLocalRecordType, operatorv1.TXTLocalRecordType:
+		default:
+			return fmt.Errorf("local record %q has unsupported type %q", record.Name, record.Type)
+		}
+		if record.Type == operatorv1.CNAMELocalRecordType && name == zone {
+			return fmt.Errorf("local record %q must not alias the zone apex", record.Name)
+		}
+		if clusterZone := strings.ToLower(clusterDomain) + "."; record.Type == operatorv1.CNAMELocalRecordType && (name == clusterZone || strings.HasSuffix(name, "."+clusterZone)) {
+			return fmt.Errorf("local record %q must not be a CNAME within the cluster domain %q", record.Name, clusterDomain)
+		}
+		key := name + "/" + string(record.Type)
+		if _, conflict := seen[key]; conflict {
+			return fmt.Errorf("local records contain more than one %s record for %q", record.Type, record.Name)
+		}
+		seen[key] = struct{}{}
+		if len(record.Values) == 0 {
+			return fmt.Errorf("local record %q must specify at least one value", record.Name)
+		}
+	}
+	return nil
+}
+
+// coreDNSLocalRecordsBlock renders the `file` plugin block that serves
+// Spec.LocalRecords from the zonefile the generator writes into the
+// ConfigMap's second key, or an empty string when no records are declared.
+func coreDNSLocalRecordsBlock(spec operatorv1.LocalRecordsSpec, zonefilePath string) (string, error) {
+	if len(spec.Records) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("file %s %s {\n        reload 30s\n    }", zonefilePath, spec.Zone), nil
+}
+
+// buildLocalRecordsZonefile renders spec.Records as an RFC 1035 zonefile,
+// synthesizing a minimal SOA/NS pair so the CoreDNS file plugin accepts it
+// as authoritative for the zone.
+func buildLocalRecordsZonefile(spec operatorv1.LocalRecordsSpec) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "$ORIGIN %s\n$TTL 3600\n", spec.Zone)
+	fmt.Fprintf(&b, "@ IN SOA ns.%[1]s hostmaster.%[1]s ( 1 3600 900 604800 300 )\n", spec.Zone)
+	fmt.Fprintf(&b, "@ IN NS ns.%s\n", spec.Zone)
+
+	for _, record := range spec.Records {
+		ttl := record.TTLSeconds
+		if ttl == 0 {
+			ttl = 3600
+		}
+		for _, value := range record.Values {
+			switch record.Type {
+			case operatorv1.TXTLocalRecordType:
+				fmt.Fprintf(&b, "%s %d IN TXT %q\n", record.Name, ttl, value)
+			default:
+				fmt.Fprintf(&b, "%s %d IN %s %s\n", record.Name, ttl, record.Type, value)
+			}
+		}
+	}
+	return b.String()
+}
+
+// DNSConfigMapHash computes a stable hash over a DNS ConfigMap's data, so a
+// daemonset reconciler can roll pods when the Corefile or local-records
+// zonefile changes even if the ConfigMap name itself stays the same.
+func DNSConfigMapHash(cm *corev1.ConfigMap) string {
+	keys := make([]string, 0, len(cm.Data))
+	for k := range cm.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%s\n", k, cm.Data[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 func coreDNSResolver(upstream operatorv1.Upstream) (string, error) {
-	if upstream.Type == operatorv1.NetworkResolverType {
-		if upstream.Address == "" {
-			return "", errInvalidNetworkUpstream
+	if upstream.Type != operatorv1.NetworkResolverType {
+		if upstream.Protocol != "" && upstream.Protocol != operatorv1.UDPProtocol && upstream.Protocol != operatorv1.TCPProtocol {
+			return "", errInvalidProtocolForSystemUpstream
+		}
+		return resolvConf, nil
+	}
+	if upstream.Address == "" {
+		return "", errInvalidNetworkUpstream
+	}
+
+	port := upstream.Port
+	switch upstream.Protocol {
+	case operatorv1.TLSProtocol:
+		if port == 0 {
+			port = 853
+		}
+		return fmt.Sprintf("tls://%s", net.JoinHostPort(upstream.Address, fmt.Sprintf("%d", port))), nil
+	case operatorv1.HTTPSProtocol:
+		if port == 0 {
+			port = 443
 		}
-		if upstream.Port > 0 {
-			return net.JoinHostPort(upstream.Address, fmt.Sprintf("%d", upstream.Port)), nil
-		} else {
-			return upstream.Address, nil
+		return fmt.Sprintf("https://%s/dns-query", net.JoinHostPort(upstream.Address, fmt.Sprintf("%d", port))), nil
+	case operatorv1.QUICProtocol:
+		if port == 0 {
+			port = 853
 		}
+		return fmt.Sprintf("quic://%s", net.JoinHostPort(upstream.Address, fmt.Sprintf("%d", port))), nil
+	default:
+		if port > 0 {
+			return net.JoinHostPort(upstream.Address, fmt.Sprintf("%d", port)), nil
+		}
+		return upstream.Address, nil
+	}
+}
+
+// coreDNSForwardOptions aggregates the per-upstream TLS/transport/health
+// settings that CoreDNS only accepts once per forward block, and rejects
+// upstreams within the same block that disagree on them.
+func coreDNSForwardOptions(upstreams []operatorv1.Upstream) (forwardOptions, error) {
+	var opts forwardOptions
+	for _, upstream := range upstreams {
+		if upstream.ServerName != "" {
+			if opts.TLSServerName != "" && opts.TLSServerName != upstream.ServerName {
+				return forwardOptions{}, fmt.Errorf("upstreams in the same forward block specify conflicting server names %q and %q", opts.TLSServerName, upstream.ServerName)
+			}
+			opts.TLSServerName = upstream.ServerName
+		}
+		if upstream.ForceTCP {
+			opts.ForceTCP = true
+		}
+		if upstream.PreferUDP {
+			opts.PreferUDP = true
+		}
+		if upstream.HealthCheckIntervalSeconds < 0 {
+			return forwardOptions{}, fmt.Errorf("healthCheckIntervalSeconds must not be negative")
+		} else if upstream.HealthCheckIntervalSeconds > 0 {
+			if opts.HealthCheckIntervalSeconds != 0 && opts.HealthCheckIntervalSeconds != upstream.HealthCheckIntervalSeconds {
+				return forwardOptions{}, fmt.Errorf("upstreams in the same forward block specify conflicting healthCheckIntervalSeconds values %d and %d", opts.HealthCheckIntervalSeconds, upstream.HealthCheckIntervalSeconds)
+			}
+			opts.HealthCheckIntervalSeconds = upstream.HealthCheckIntervalSeconds
+		}
+		if upstream.MaxFails < 0 {
+			return forwardOptions{}, fmt.Errorf("maxFails must not be negative")
+		} else if upstream.MaxFails > 0 {
+			if opts.MaxFails != 0 && opts.MaxFails != upstream.MaxFails {
+				return forwardOptions{}, fmt.Errorf("upstreams in the same forward block specify conflicting maxFails values %d and %d", opts.MaxFails, upstream.MaxFails)
+			}
+			opts.MaxFails = upstream.MaxFails
+		}
+		if upstream.ExpireSeconds > 0 {
+			if opts.ExpireSeconds != 0 && opts.ExpireSeconds != upstream.ExpireSeconds {
+				return forwardOptions{}, fmt.Errorf("upstreams in the same forward block specify conflicting expireSeconds values %d and %d", opts.ExpireSeconds, upstream.ExpireSeconds)
+			}
+			opts.ExpireSeconds = upstream.ExpireSeconds
+		}
+		if upstream.FailfastAllUnhealthyUpstreams {
+			opts.FailfastAllUnhealthyUpstreams = true
+		}
+	}
+	if opts.ForceTCP && opts.PreferUDP {
+		return forwardOptions{}, fmt.Errorf("force_tcp and prefer_udp are mutually exclusive within the same forward block")
 	}
-	return resolvConf, nil
+	return opts, nil
 }
 
 func coreDNSPolicy(policy operatorv1.ForwardingPolicy) string {
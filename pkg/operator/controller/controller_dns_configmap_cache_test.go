@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+)
+
+// TestCoreDNSCachePolicyDefaults verifies that a zero-valued CachePolicy
+// renders the same directives CoreDNS used to get hardcoded.
+func TestCoreDNSCachePolicyDefaults(t *testing.T) {
+	got, err := coreDNSCachePolicy(operatorv1.CachePolicy{})
+	if err != nil {
+		t.Fatalf("coreDNSCachePolicy() returned unexpected error: %v", err)
+	}
+	want := "cache 900 {\n        denial 9984 30\n    }"
+	if got != want {
+		t.Errorf("coreDNSCachePolicy() = %q, want %q", got, want)
+	}
+}
+
+func TestCoreDNSCachePolicyFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy operatorv1.CachePolicy
+		want   string
+	}{
+		{
+			name:   "disabled policy renders nothing",
+			policy: operatorv1.CachePolicy{Disabled: true},
+			want:   "",
+		},
+		{
+			name:   "explicit positive and negative TTLs",
+			policy: operatorv1.CachePolicy{PositiveTTLSeconds: 60, NegativeTTLSeconds: 10},
+			want:   "cache 60 {\n        denial 9984 10\n    }",
+		},
+		{
+			name:   "success line appears only when MaxPositiveEntries is set",
+			policy: operatorv1.CachePolicy{MaxPositiveEntries: 500},
+			want:   "cache 900 {\n        success 500\n        denial 9984 30\n    }",
+		},
+		{
+			name:   "prefetch with an explicit duration",
+			policy: operatorv1.CachePolicy{Prefetch: &operatorv1.CachePrefetchPolicy{Amount: 10, Duration: "30s", Percentage: 20}},
+			want:   "cache 900 {\n        denial 9984 30\n        prefetch 10 30s 20%\n    }",
+		},
+		{
+			name:   "prefetch with no duration falls back to the default",
+			policy: operatorv1.CachePolicy{Prefetch: &operatorv1.CachePrefetchPolicy{Amount: 10, Percentage: 20}},
+			want:   "cache 900 {\n        denial 9984 30\n        prefetch 10 " + defaultCachePrefetchDuration + " 20%\n    }",
+		},
+		{
+			name:   "serve_stale renders its duration",
+			policy: operatorv1.CachePolicy{ServeStale: &operatorv1.CacheServeStalePolicy{Duration: "1h"}},
+			want:   "cache 900 {\n        denial 9984 30\n        serve_stale 1h\n    }",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := coreDNSCachePolicy(tt.policy)
+			if err != nil {
+				t.Fatalf("coreDNSCachePolicy() returned unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("coreDNSCachePolicy() = %q, want %q", got, tt.want)
+			}
+			if !tt.policy.Disabled && tt.policy.Prefetch != nil {
+				if !strings.Contains(got, "prefetch ") {
+					t.Errorf("coreDNSCachePolicy() = %q, want it to contain a prefetch directive", got)
+				}
+			}
+		})
+	}
+}
+
+// TestValidateCachePolicyErrors verifies every field validateCachePolicy is
+// responsible for, plus the one CoreDNS-breaking case it must still allow
+// (an empty Prefetch.Duration, which coreDNSCachePolicy now defaults).
+func TestValidateCachePolicyErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  operatorv1.CachePolicy
+		wantErr bool
+	}{
+		{name: "negative positive TTL", policy: operatorv1.CachePolicy{PositiveTTLSeconds: -1}, wantErr: true},
+		{name: "negative negative TTL", policy: operatorv1.CachePolicy{NegativeTTLSeconds: -1}, wantErr: true},
+		{name: "negative max positive entries", policy: operatorv1.CachePolicy{MaxPositiveEntries: -1}, wantErr: true},
+		{name: "negative max negative entries", policy: operatorv1.CachePolicy{MaxNegativeEntries: -1}, wantErr: true},
+		{name: "negative prefetch amount", policy: operatorv1.CachePolicy{Prefetch: &operatorv1.CachePrefetchPolicy{Amount: -1}}, wantErr: true},
+		{name: "prefetch percentage over 100", policy: operatorv1.CachePolicy{Prefetch: &operatorv1.CachePrefetchPolicy{Percentage: 101}}, wantErr: true},
+		{name: "prefetch percentage under 0", policy: operatorv1.CachePolicy{Prefetch: &operatorv1.CachePrefetchPolicy{Percentage: -1}}, wantErr: true},
+		{name: "invalid prefetch duration", policy: operatorv1.CachePolicy{Prefetch: &operatorv1.CachePrefetchPolicy{Duration: "not-a-duration"}}, wantErr: true},
+		{name: "empty prefetch duration is allowed", policy: operatorv1.CachePolicy{Prefetch: &operatorv1.CachePrefetchPolicy{Amount: 10, Percentage: 10}}, wantErr: false},
+		{name: "invalid serve_stale duration", policy: operatorv1.CachePolicy{ServeStale: &operatorv1.CacheServeStalePolicy{Duration: "not-a-duration"}}, wantErr: true},
+		{name: "valid policy", policy: operatorv1.CachePolicy{PositiveTTLSeconds: 60, NegativeTTLSeconds: 10, MaxPositiveEntries: 100, MaxNegativeEntries: 100}, wantErr: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCachePolicy(tt.policy)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateCachePolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestEffectiveCachePolicy verifies the per-server override falls back to
+// the cluster-wide policy only when unset.
+func TestEffectiveCachePolicy(t *testing.T) {
+	global := operatorv1.CachePolicy{PositiveTTLSeconds: 900}
+	server := operatorv1.CachePolicy{PositiveTTLSeconds: 60}
+
+	if got := effectiveCachePolicy(nil, global); got != global {
+		t.Errorf("effectiveCachePolicy(nil, global) = %+v, want %+v", got, global)
+	}
+	if got := effectiveCachePolicy(&server, global); got != server {
+		t.Errorf("effectiveCachePolicy(server, global) = %+v, want %+v", got, server)
+	}
+}
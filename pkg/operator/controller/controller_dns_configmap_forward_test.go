@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"testing"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+)
+
+// TestCoreDNSForwardOptions verifies that each per-upstream tuning field
+// aggregates into the shared forwardOptions the forward block renders from,
+// and that conflicting or invalid values are rejected.
+func TestCoreDNSForwardOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		upstreams []operatorv1.Upstream
+		want      forwardOptions
+		wantErr   bool
+	}{
+		{
+			name:      "no upstreams yields zero-valued options",
+			upstreams: nil,
+			want:      forwardOptions{},
+		},
+		{
+			name:      "health_check is carried through",
+			upstreams: []operatorv1.Upstream{{HealthCheckIntervalSeconds: 5}},
+			want:      forwardOptions{HealthCheckIntervalSeconds: 5},
+		},
+		{
+			name:      "max_fails is carried through",
+			upstreams: []operatorv1.Upstream{{MaxFails: 3}},
+			want:      forwardOptions{MaxFails: 3},
+		},
+		{
+			name:      "expire is carried through",
+			upstreams: []operatorv1.Upstream{{ExpireSeconds: 30}},
+			want:      forwardOptions{ExpireSeconds: 30},
+		},
+		{
+			name:      "failfast_all_unhealthy_upstreams is carried through",
+			upstreams: []operatorv1.Upstream{{FailfastAllUnhealthyUpstreams: true}},
+			want:      forwardOptions{FailfastAllUnhealthyUpstreams: true},
+		},
+		{
+			name:      "force_tcp is carried through",
+			upstreams: []operatorv1.Upstream{{ForceTCP: true}},
+			want:      forwardOptions{ForceTCP: true},
+		},
+		{
+			name:      "prefer_udp is carried through",
+			upstreams: []operatorv1.Upstream{{PreferUDP: true}},
+			want:      forwardOptions{PreferUDP: true},
+		},
+		{
+			name:      "server name is carried through as tls_servername",
+			upstreams: []operatorv1.Upstream{{ServerName: "dns.example.com"}},
+			want:      forwardOptions{TLSServerName: "dns.example.com"},
+		},
+		{
+			name: "agreeing server names across upstreams is fine",
+			upstreams: []operatorv1.Upstream{
+				{ServerName: "dns.example.com"},
+				{ServerName: "dns.example.com"},
+			},
+			want: forwardOptions{TLSServerName: "dns.example.com"},
+		},
+		{
+			name: "conflicting server names are rejected",
+			upstreams: []operatorv1.Upstream{
+				{ServerName: "a.example.com"},
+				{ServerName: "b.example.com"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "force_tcp and prefer_udp are mutually exclusive",
+			upstreams: []operatorv1.Upstream{
+				{ForceTCP: true},
+				{PreferUDP: true},
+			},
+			wantErr: true,
+		},
+		{
+			name:      "negative health_check is rejected",
+			upstreams: []operatorv1.Upstream{{HealthCheckIntervalSeconds: -1}},
+			wantErr:   true,
+		},
+		{
+			name:      "negative max_fails is rejected",
+			upstreams: []operatorv1.Upstream{{MaxFails: -1}},
+			wantErr:   true,
+		},
+		{
+			name: "agreeing health_check values across upstreams is fine",
+			upstreams: []operatorv1.Upstream{
+				{HealthCheckIntervalSeconds: 5},
+				{HealthCheckIntervalSeconds: 5},
+			},
+			want: forwardOptions{HealthCheckIntervalSeconds: 5},
+		},
+		{
+			name: "conflicting health_check values are rejected",
+			upstreams: []operatorv1.Upstream{
+				{HealthCheckIntervalSeconds: 5},
+				{HealthCheckIntervalSeconds: 10},
+			},
+			wantErr: true,
+		},
+		{
+			name: "conflicting max_fails values are rejected",
+			upstreams: []operatorv1.Upstream{
+				{MaxFails: 2},
+				{MaxFails: 3},
+			},
+			wantErr: true,
+		},
+		{
+			name: "conflicting expire values are rejected",
+			upstreams: []operatorv1.Upstream{
+				{ExpireSeconds: 30},
+				{ExpireSeconds: 60},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := coreDNSForwardOptions(tt.upstreams)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("coreDNSForwardOptions() expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("coreDNSForwardOptions() returned unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("coreDNSForwardOptions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestValidateUpstreamsRejectsInvalidForwardOptions verifies that
+// validateUpstreams surfaces coreDNSForwardOptions' errors, so a bad
+// forward-tuning value fails fast instead of reaching template execution.
+func TestValidateUpstreamsRejectsInvalidForwardOptions(t *testing.T) {
+	upstreams := []operatorv1.Upstream{
+		{Type: operatorv1.NetworkResolverType, Address: "1.1.1.1", HealthCheckIntervalSeconds: -1},
+	}
+	if err := validateUpstreams(upstreams, true); err == nil {
+		t.Errorf("validateUpstreams() expected an error for a negative healthCheckIntervalSeconds, got none")
+	}
+}
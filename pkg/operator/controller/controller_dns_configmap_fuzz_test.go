@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// countBraces reports the number of '{' and '}' runes in s, so fuzz targets
+// can assert a rendered Corefile never leaves a block unterminated.
+func countBraces(s string) (open, close int) {
+	for _, r := range s {
+		switch r {
+		case '{':
+			open++
+		case '}':
+			close++
+		}
+	}
+	return open, close
+}
+
+// countServerBlocks counts top-level "zone:5353 {" server declarations in a
+// rendered Corefile, which is a loose but sufficient proxy for "one server
+// block per Spec.Servers entry plus the catch-all". It must not match the
+// many other directives that also end a line in "{" inside a server block
+// (log, health, kubernetes, forward, cache, ...), so it keys on the literal
+// ":5353 {" suffix the template only ever emits on a zone declaration line.
+func countServerBlocks(corefile string) int {
+	count := 0
+	for _, line := range strings.Split(corefile, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasSuffix(line, ":5353 {") {
+			count++
+		}
+	}
+	return count
+}
+
+func fuzzDNS(zoneName, address, serverName string, port uint16, protocol uint8, policy uint8, logLevel uint8, withServer bool) *operatorv1.DNS {
+	protocols := []operatorv1.UpstreamProtocol{"", operatorv1.UDPProtocol, operatorv1.TCPProtocol, operatorv1.TLSProtocol, operatorv1.HTTPSProtocol, operatorv1.QUICProtocol}
+	policies := []operatorv1.ForwardingPolicy{"", operatorv1.RandomForwardingPolicy, operatorv1.RoundRobinForwardingPolicy, operatorv1.SequentialForwardingPolicy}
+	logLevels := []operatorv1.DNSLogLevel{"", operatorv1.DNSLogLevelNormal, operatorv1.DNSLogLevelDebug, operatorv1.DNSLogLevelTrace}
+
+	upstream := operatorv1.Upstream{
+		Type:       operatorv1.NetworkResolverType,
+		Address:    address,
+		Port:       uint32(port),
+		Protocol:   protocols[int(protocol)%len(protocols)],
+		ServerName: serverName,
+	}
+
+	dns := &operatorv1.DNS{
+		ObjectMeta: metav1.ObjectMeta{Name: "default"},
+		Spec: operatorv1.DNSSpec{
+			UpstreamResolvers: operatorv1.UpstreamResolvers{
+				Upstreams: []operatorv1.Upstream{upstream},
+				Policy:    policies[int(policy)%len(policies)],
+			},
+			LogLevel: logLevels[int(logLevel)%len(logLevels)],
+		},
+	}
+	if withServer {
+		dns.Spec.Servers = []operatorv1.Server{
+			{
+				Name:  "fuzz-server",
+				Zones: []string{zoneName},
+				ForwardPlugin: operatorv1.ForwardPlugin{
+					Upstreams: []operatorv1.Upstream{upstream},
+					Policy:    policies[int(policy)%len(policies)],
+				},
+			},
+		}
+	}
+	return dns
+}
+
+// FuzzDesiredDNSConfigMap exercises the full Corefile generator with random
+// zone names, upstream addresses/ports/protocols, policies, and log levels.
+// It never expects desiredDNSConfigMap to panic, and whenever it succeeds,
+// the rendered Corefile must have balanced braces and one block per
+// declared server plus the catch-all.
+func FuzzDesiredDNSConfigMap(f *testing.F) {
+	f.Add("example.com.", "1.1.1.1", "", uint16(0), uint8(0), uint8(0), uint8(0), true)
+	f.Add("example.com.", "", "", uint16(853), uint8(3), uint8(1), uint8(1), false)
+	f.Add("", "::1", "dns.example.com", uint16(65535), uint8(5), uint8(2), uint8(2), true)
+	f.Add("with\nnewline.", "not-an-ip", "sni.example.com", uint16(443), uint8(4), uint8(3), uint8(3), true)
+	f.Add(strings.Repeat("a", 300)+".", "2001:db8::1", "", uint16(80), uint8(2), uint8(0), uint8(0), false)
+
+	f.Fuzz(func(t *testing.T, zoneName, address, serverName string, port uint16, protocol, policy, logLevel uint8, withServer bool) {
+		dns := fuzzDNS(zoneName, address, serverName, port, protocol, policy, logLevel, withServer)
+
+		cm, err := desiredDNSConfigMap(dns, "cluster.local", true, true, "")
+		if err != nil {
+			return
+		}
+		if cm == nil {
+			t.Fatalf("desiredDNSConfigMap returned a nil configmap with no error")
+		}
+		corefile := cm.Data["Corefile"]
+		open, closeBraces := countBraces(corefile)
+		if open != closeBraces {
+			t.Fatalf("unbalanced braces in rendered Corefile (%d open, %d close):\n%s", open, closeBraces, corefile)
+		}
+
+		wantBlocks := 1 // catch-all
+		if withServer {
+			wantBlocks++
+		}
+		if got := countServerBlocks(corefile); got != wantBlocks {
+			t.Fatalf("got %d server blocks, want %d:\n%s", got, wantBlocks, corefile)
+		}
+	})
+}
+
+// FuzzCoreDNSResolver checks that coreDNSResolver never panics on arbitrary
+// upstream configurations and never returns a resolver string while also
+// returning an error.
+func FuzzCoreDNSResolver(f *testing.F) {
+	f.Add("1.1.1.1", uint16(853), "tls", "sni.example.com", true)
+	f.Add("", uint16(0), "https", "", true)
+	f.Add("2001:db8::1", uint16(0), "quic", "", true)
+	f.Add("resolver.internal", uint16(53), "", "", false)
+
+	f.Fuzz(func(t *testing.T, address string, port uint16, protocol, serverName string, network bool) {
+		upstreamType := operatorv1.SystemResolveConfType
+		if network {
+			upstreamType = operatorv1.NetworkResolverType
+		}
+		upstream := operatorv1.Upstream{
+			Type:       upstreamType,
+			Address:    address,
+			Port:       uint32(port),
+			Protocol:   operatorv1.UpstreamProtocol(protocol),
+			ServerName: serverName,
+		}
+
+		resolver, err := coreDNSResolver(upstream)
+		if err != nil && resolver != "" {
+			t.Fatalf("coreDNSResolver returned both a resolver (%q) and an error: %v", resolver, err)
+		}
+	})
+}
+
+// FuzzCoreDNSPolicyAndLogLevel checks that the small enum-rendering helpers
+// always return one of their known CoreDNS directive values, for any input.
+func FuzzCoreDNSPolicyAndLogLevel(f *testing.F) {
+	f.Add("Random", "Normal")
+	f.Add("", "")
+	f.Add("bogus", "bogus")
+
+	validPolicies := map[string]bool{"random": true, "round_robin": true, "sequential": true}
+	validLogLevels := map[string]bool{"class error": true, "class denial error": true, "class all": true}
+
+	f.Fuzz(func(t *testing.T, policy, logLevel string) {
+		if got := coreDNSPolicy(operatorv1.ForwardingPolicy(policy)); !validPolicies[got] {
+			t.Fatalf("coreDNSPolicy(%q) = %q, not a known policy directive", policy, got)
+		}
+		dns := &operatorv1.DNS{Spec: operatorv1.DNSSpec{LogLevel: operatorv1.DNSLogLevel(logLevel)}}
+		if got := coreDNSLogLevel(dns); !validLogLevels[got] {
+			t.Fatalf("coreDNSLogLevel(%q) = %q, not a known log directive", logLevel, got)
+		}
+	})
+}
@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+)
+
+// TestValidateLocalRecords covers every rejection validateLocalRecords is
+// responsible for, so the Corefile generator never has to fail on a
+// malformed zonefile at template-execution time.
+func TestValidateLocalRecords(t *testing.T) {
+	tests := []struct {
+		name          string
+		spec          operatorv1.LocalRecordsSpec
+		clusterDomain string
+		wantErr       bool
+	}{
+		{
+			name: "no records is always valid",
+			spec: operatorv1.LocalRecordsSpec{},
+		},
+		{
+			name: "valid zone and records",
+			spec: operatorv1.LocalRecordsSpec{
+				Zone: "apps.example.com.",
+				Records: []operatorv1.LocalRecord{
+					{Name: "svc.apps.example.com.", Type: operatorv1.ALocalRecordType, Values: []string{"10.0.0.1"}},
+				},
+			},
+			clusterDomain: "cluster.local",
+		},
+		{
+			name: "zone not fully qualified",
+			spec: operatorv1.LocalRecordsSpec{
+				Zone:    "apps.example.com",
+				Records: []operatorv1.LocalRecord{{Name: "apps.example.com.", Values: []string{"10.0.0.1"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "zone must not be the cluster domain",
+			spec: operatorv1.LocalRecordsSpec{
+				Zone:    "cluster.local.",
+				Records: []operatorv1.LocalRecord{{Name: "cluster.local.", Values: []string{"10.0.0.1"}}},
+			},
+			clusterDomain: "cluster.local",
+			wantErr:       true,
+		},
+		{
+			name: "record name not fully qualified",
+			spec: operatorv1.LocalRecordsSpec{
+				Zone:    "apps.example.com.",
+				Records: []operatorv1.LocalRecord{{Name: "svc.apps.example.com", Values: []string{"10.0.0.1"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "record outside the declared zone",
+			spec: operatorv1.LocalRecordsSpec{
+				Zone:    "apps.example.com.",
+				Records: []operatorv1.LocalRecord{{Name: "svc.other.example.com.", Values: []string{"10.0.0.1"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "CNAME at the zone apex",
+			spec: operatorv1.LocalRecordsSpec{
+				Zone:    "apps.example.com.",
+				Records: []operatorv1.LocalRecord{{Name: "apps.example.com.", Type: operatorv1.CNAMELocalRecordType, Values: []string{"target.example.com."}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicate name/type pair",
+			spec: operatorv1.LocalRecordsSpec{
+				Zone: "apps.example.com.",
+				Records: []operatorv1.LocalRecord{
+					{Name: "svc.apps.example.com.", Type: operatorv1.ALocalRecordType, Values: []string{"10.0.0.1"}},
+					{Name: "svc.apps.example.com.", Type: operatorv1.ALocalRecordType, Values: []string{"10.0.0.2"}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "record with no values",
+			spec: operatorv1.LocalRecordsSpec{
+				Zone:    "apps.example.com.",
+				Records: []operatorv1.LocalRecord{{Name: "svc.apps.example.com.", Type: operatorv1.ALocalRecordType}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsupported record type",
+			spec: operatorv1.LocalRecordsSpec{
+				Zone:    "apps.example.com.",
+				Records: []operatorv1.LocalRecord{{Name: "svc.apps.example.com.", Type: "MX", Values: []string{"10.0.0.1"}}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clusterDomain := tt.clusterDomain
+			if clusterDomain == "" {
+				clusterDomain = "cluster.local"
+			}
+			err := validateLocalRecords(tt.spec, clusterDomain)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateLocalRecords() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestCoreDNSLocalRecordsBlock verifies the `file` plugin block is only
+// rendered when records are declared, and references the given zonefile
+// path and zone.
+func TestCoreDNSLocalRecordsBlock(t *testing.T) {
+	got, err := coreDNSLocalRecordsBlock(operatorv1.LocalRecordsSpec{}, localRecordsZonefileMountPath)
+	if err != nil {
+		t.Fatalf("coreDNSLocalRecordsBlock() returned unexpected error: %v", err)
+	}
+	if got != "" {
+		t.Errorf("coreDNSLocalRecordsBlock() with no records = %q, want empty", got)
+	}
+
+	spec := operatorv1.LocalRecordsSpec{
+		Zone:    "apps.example.com.",
+		Records: []operatorv1.LocalRecord{{Name: "svc.apps.example.com.", Values: []string{"10.0.0.1"}}},
+	}
+	got, err = coreDNSLocalRecordsBlock(spec, localRecordsZonefileMountPath)
+	if err != nil {
+		t.Fatalf("coreDNSLocalRecordsBlock() returned unexpected error: %v", err)
+	}
+	want := "file " + localRecordsZonefileMountPath + " apps.example.com. {\n        reload 30s\n    }"
+	if got != want {
+		t.Errorf("coreDNSLocalRecordsBlock() = %q, want %q", got, want)
+	}
+}
+
+// TestBuildLocalRecordsZonefile verifies the rendered zonefile carries an
+// SOA/NS pair plus one resource record per value, covers each supported
+// record type's rendering (TXT values are quoted, everything else is not),
+// and defaults TTLSeconds when unset.
+func TestBuildLocalRecordsZonefile(t *testing.T) {
+	spec := operatorv1.LocalRecordsSpec{
+		Zone: "apps.example.com.",
+		Records: []operatorv1.LocalRecord{
+			{Name: "a.apps.example.com.", Type: operatorv1.ALocalRecordType, Values: []string{"10.0.0.1"}},
+			{Name: "aaaa.apps.example.com.", Type: operatorv1.AAAALocalRecordType, Values: []string{"2001:db8::1"}, TTLSeconds: 60},
+			{Name: "alias.apps.example.com.", Type: operatorv1.CNAMELocalRecordType, Values: []string{"a.apps.example.com."}},
+			{Name: "_svc._tcp.apps.example.com.", Type: operatorv1.SRVLocalRecordType, Values: []string{"0 5 8080 a.apps.example.com."}},
+			{Name: "txt.apps.example.com.", Type: operatorv1.TXTLocalRecordType, Values: []string{"v=hello"}},
+		},
+	}
+
+	got := buildLocalRecordsZonefile(spec)
+
+	for _, want := range []string{
+		"$ORIGIN apps.example.com.\n$TTL 3600\n",
+		"@ IN SOA ns.apps.example.com. hostmaster.apps.example.com. ( 1 3600 900 604800 300 )\n",
+		"@ IN NS ns.apps.example.com.\n",
+		"a.apps.example.com. 3600 IN A 10.0.0.1\n",
+		"aaaa.apps.example.com. 60 IN AAAA 2001:db8::1\n",
+		"alias.apps.example.com. 3600 IN CNAME a.apps.example.com.\n",
+		"_svc._tcp.apps.example.com. 3600 IN SRV 0 5 8080 a.apps.example.com.\n",
+		`txt.apps.example.com. 3600 IN TXT "v=hello"` + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("buildLocalRecordsZonefile() missing %q in:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"testing"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+)
+
+// TestCoreDNSResolverProtocols verifies that coreDNSResolver renders the
+// scheme and default port expected by each upstream protocol, and that an
+// explicit port always overrides the default.
+func TestCoreDNSResolverProtocols(t *testing.T) {
+	tests := []struct {
+		name     string
+		upstream operatorv1.Upstream
+		want     string
+	}{
+		{
+			name:     "plain network upstream defaults to bare address",
+			upstream: operatorv1.Upstream{Type: operatorv1.NetworkResolverType, Address: "1.1.1.1"},
+			want:     "1.1.1.1",
+		},
+		{
+			name:     "network upstream with explicit port",
+			upstream: operatorv1.Upstream{Type: operatorv1.NetworkResolverType, Address: "1.1.1.1", Port: 5353},
+			want:     "1.1.1.1:5353",
+		},
+		{
+			name:     "TLS upstream defaults to port 853",
+			upstream: operatorv1.Upstream{Type: operatorv1.NetworkResolverType, Address: "1.1.1.1", Protocol: operatorv1.TLSProtocol},
+			want:     "tls://1.1.1.1:853",
+		},
+		{
+			name:     "TLS upstream honors an explicit port",
+			upstream: operatorv1.Upstream{Type: operatorv1.NetworkResolverType, Address: "1.1.1.1", Protocol: operatorv1.TLSProtocol, Port: 8853},
+			want:     "tls://1.1.1.1:8853",
+		},
+		{
+			name:     "HTTPS upstream defaults to port 443 and the dns-query path",
+			upstream: operatorv1.Upstream{Type: operatorv1.NetworkResolverType, Address: "1.1.1.1", Protocol: operatorv1.HTTPSProtocol},
+			want:     "https://1.1.1.1:443/dns-query",
+		},
+		{
+			name:     "HTTPS upstream honors an explicit port",
+			upstream: operatorv1.Upstream{Type: operatorv1.NetworkResolverType, Address: "1.1.1.1", Protocol: operatorv1.HTTPSProtocol, Port: 4443},
+			want:     "https://1.1.1.1:4443/dns-query",
+		},
+		{
+			name:     "system upstream with no protocol returns resolv.conf",
+			upstream: operatorv1.Upstream{Type: operatorv1.SystemResolveConfType},
+			want:     resolvConf,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := coreDNSResolver(tt.upstream)
+			if err != nil {
+				t.Fatalf("coreDNSResolver returned unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("coreDNSResolver() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestValidateUpstreamsProtocolRestrictions verifies that TLS/HTTPS protocols
+// are rejected for anything but a Network-type upstream.
+func TestValidateUpstreamsProtocolRestrictions(t *testing.T) {
+	tests := []struct {
+		name      string
+		upstreams []operatorv1.Upstream
+		wantErr   error
+	}{
+		{
+			name: "TLS protocol on a system upstream is rejected",
+			upstreams: []operatorv1.Upstream{
+				{Type: operatorv1.SystemResolveConfType, Protocol: operatorv1.TLSProtocol},
+			},
+			wantErr: errInvalidProtocolForSystemUpstream,
+		},
+		{
+			name: "HTTPS protocol on a system upstream is rejected",
+			upstreams: []operatorv1.Upstream{
+				{Type: operatorv1.SystemResolveConfType, Protocol: operatorv1.HTTPSProtocol},
+			},
+			wantErr: errInvalidProtocolForSystemUpstream,
+		},
+		{
+			name: "TLS protocol on a network upstream is accepted",
+			upstreams: []operatorv1.Upstream{
+				{Type: operatorv1.NetworkResolverType, Address: "1.1.1.1", Protocol: operatorv1.TLSProtocol},
+			},
+			wantErr: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateUpstreams(tt.upstreams, true)
+			if err != tt.wantErr {
+				t.Errorf("validateUpstreams() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"testing"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+)
+
+// TestCoreDNSResolverQUIC verifies that a QUIC upstream renders with the
+// quic:// scheme and defaults to port 853 like the other DoT-family
+// protocols, while still honoring an explicit port.
+func TestCoreDNSResolverQUIC(t *testing.T) {
+	tests := []struct {
+		name     string
+		upstream operatorv1.Upstream
+		want     string
+	}{
+		{
+			name:     "defaults to port 853",
+			upstream: operatorv1.Upstream{Type: operatorv1.NetworkResolverType, Address: "1.1.1.1", Protocol: operatorv1.QUICProtocol},
+			want:     "quic://1.1.1.1:853",
+		},
+		{
+			name:     "honors an explicit port",
+			upstream: operatorv1.Upstream{Type: operatorv1.NetworkResolverType, Address: "1.1.1.1", Protocol: operatorv1.QUICProtocol, Port: 8853},
+			want:     "quic://1.1.1.1:8853",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := coreDNSResolver(tt.upstream)
+			if err != nil {
+				t.Fatalf("coreDNSResolver returned unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("coreDNSResolver() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestValidateUpstreamsQUICFeatureGate verifies that the QUIC protocol is
+// only accepted when the DNSOverQUIC feature gate is enabled.
+func TestValidateUpstreamsQUICFeatureGate(t *testing.T) {
+	upstreams := []operatorv1.Upstream{
+		{Type: operatorv1.NetworkResolverType, Address: "1.1.1.1", Protocol: operatorv1.QUICProtocol},
+	}
+
+	if err := validateUpstreams(upstreams, false); err != errQUICProtocolNotEnabled {
+		t.Errorf("validateUpstreams() with the gate disabled = %v, want %v", err, errQUICProtocolNotEnabled)
+	}
+	if err := validateUpstreams(upstreams, true); err != nil {
+		t.Errorf("validateUpstreams() with the gate enabled = %v, want nil", err)
+	}
+}
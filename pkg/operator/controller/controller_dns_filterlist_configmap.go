@@ -0,0 +1,291 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/openshift/cluster-dns-operator/pkg/manifests"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// filterListHostsMountPath is where the filter list reconciler writes
+	// the blocked-domain hosts file and where the Corefile's hosts plugin
+	// expects to find it mounted.
+	filterListHostsMountPath = "/etc/coredns/filtering/blocklist.hosts"
+
+	filterListHostsDataKey = "blocklist.hosts"
+	filterListRegexDataKey = "blocklist.regex"
+
+	// filterListDisabledAnnotation is a kill-switch: when set to "true" on
+	// the DNS object, the filter list reconciler stops refreshing sources
+	// and the generator omits the filtering plugin block, without anyone
+	// needing to remove Spec.Filtering itself.
+	filterListDisabledAnnotation = "dns.operator.openshift.io/filtering-disabled"
+
+	filterListSourceHashAnnotation = "dns.operator.openshift.io/filter-list-source-hash"
+
+	defaultFilterListRefreshInterval = 1 * time.Hour
+
+	// maxFilterListSourceBytes bounds how much of a URL source we read, so
+	// a misbehaving or compromised list can't exhaust reconciler memory.
+	maxFilterListSourceBytes = 8 << 20
+)
+
+// filterListSourceEntries is an operator-side metric scraped from the
+// cluster-dns-operator's own controller-runtime metrics endpoint, not from
+// CoreDNS's in-pod prometheus plugin at 127.0.0.1:9153 — the reconciler that
+// fetches and merges Spec.Filtering sources runs in the operator process, so
+// it has no way to surface a gauge on a DNS daemonset pod's own endpoint.
+var filterListSourceEntries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "dns_operator_filter_list_source_entries",
+	Help: "Number of domain entries contributed by each DNS filtering source.",
+}, []string{"dns", "source"})
+
+func init() {
+	metrics.Registry.MustRegister(filterListSourceEntries)
+}
+
+// FilterListConfigMapName returns the namespaced name of the ConfigMap that
+// holds the compiled blocklist for a DNS object's Spec.Filtering sources.
+func FilterListConfigMapName(dns *operatorv1.DNS) types.NamespacedName {
+	name := DNSConfigMapName(dns)
+	return types.NamespacedName{Namespace: name.Namespace, Name: name.Name + "-filter-list"}
+}
+
+// ensureFilterListConfigMap reconciles the ConfigMap backing Spec.Filtering:
+// it fetches and merges the configured sources, creates or updates the
+// ConfigMap only when the merged content actually changed, and returns how
+// long the caller should wait before requeuing to pick up upstream source
+// changes (e.g. an updated URL list) that wouldn't otherwise trigger a
+// reconcile.
+func (r *reconciler) ensureFilterListConfigMap(dns *operatorv1.DNS) (bool, *corev1.ConfigMap, time.Duration, error) {
+	refreshInterval := filterListRefreshInterval(dns)
+
+	haveCM, current, err := r.currentFilterListConfigMap(dns)
+	if err != nil {
+		return false, nil, refreshInterval, fmt.Errorf("failed to get filter list configmap: %v", err)
+	}
+
+	if !dns.Spec.Filtering.Enabled || dns.Annotations[filterListDisabledAnnotation] == "true" {
+		if haveCM {
+			if err := r.client.Delete(context.TODO(), current); err != nil && !errors.IsNotFound(err) {
+				return true, current, refreshInterval, fmt.Errorf("failed to delete filter list configmap: %v", err)
+			}
+			return false, nil, refreshInterval, nil
+		}
+		return false, nil, refreshInterval, nil
+	}
+
+	desired, err := r.desiredFilterListConfigMap(dns)
+	if err != nil {
+		return haveCM, current, refreshInterval, fmt.Errorf("failed to build filter list configmap: %v", err)
+	}
+
+	switch {
+	case !haveCM:
+		if err := r.client.Create(context.TODO(), desired); err != nil {
+			return false, nil, refreshInterval, fmt.Errorf("failed to create filter list configmap: %v", err)
+		}
+		logrus.Infof("created filter list configmap: %s", desired.Name)
+		haveCM, current, err = r.currentFilterListConfigMap(dns)
+		return haveCM, current, refreshInterval, err
+	default:
+		if current.Annotations[filterListSourceHashAnnotation] == desired.Annotations[filterListSourceHashAnnotation] {
+			return true, current, refreshInterval, nil
+		}
+		updated := current.DeepCopy()
+		updated.Data = desired.Data
+		updated.Annotations = desired.Annotations
+		if err := r.client.Update(context.TODO(), updated); err != nil {
+			return true, current, refreshInterval, fmt.Errorf("failed to update filter list configmap: %v", err)
+		}
+		logrus.Infof("updated filter list configmap: %s", updated.Name)
+		haveCM, current, err = r.currentFilterListConfigMap(dns)
+		return haveCM, current, refreshInterval, err
+	}
+}
+
+// filterListRefreshInterval returns how often the filter list reconciler
+// should re-fetch Spec.Filtering sources, defaulting when the operator
+// hasn't set an explicit interval.
+func filterListRefreshInterval(dns *operatorv1.DNS) time.Duration {
+	if seconds := dns.Spec.Filtering.RefreshIntervalSeconds; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultFilterListRefreshInterval
+}
+
+func (r *reconciler) currentFilterListConfigMap(dns *operatorv1.DNS) (bool, *corev1.ConfigMap, error) {
+	current := &corev1.ConfigMap{}
+	if err := r.client.Get(context.TODO(), FilterListConfigMapName(dns), current); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil, nil
+		}
+		return false, nil, err
+	}
+	return true, current, nil
+}
+
+func (r *reconciler) desiredFilterListConfigMap(dns *operatorv1.DNS) (*corev1.ConfigMap, error) {
+	domains := map[string]struct{}{}
+	for _, source := range dns.Spec.Filtering.Sources {
+		entries, err := r.fetchFilterSource(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch filter source %q: %v", source.Name, err)
+		}
+		filterListSourceEntries.WithLabelValues(dns.Name, source.Name).Set(float64(len(entries)))
+		for _, domain := range entries {
+			domains[domain] = struct{}{}
+		}
+	}
+	for _, domain := range dns.Spec.Filtering.Allowlist {
+		delete(domains, normalizeFilterDomain(domain))
+	}
+
+	sorted := make([]string, 0, len(domains))
+	for domain := range domains {
+		sorted = append(sorted, domain)
+	}
+	sort.Strings(sorted)
+
+	hostsBody, regexBody, hash := compileFilterList(sorted)
+
+	name := FilterListConfigMapName(dns)
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name.Name,
+			Namespace: name.Namespace,
+			Labels: map[string]string{
+				manifests.OwningDNSLabel: DNSDaemonSetLabel(dns),
+			},
+			Annotations: map[string]string{
+				filterListSourceHashAnnotation: hash,
+			},
+		},
+		Data: map[string]string{
+			filterListHostsDataKey: hostsBody,
+			filterListRegexDataKey: regexBody,
+		},
+	}
+	cm.SetOwnerReferences([]metav1.OwnerReference{dnsOwnerRef(dns)})
+	return cm, nil
+}
+
+// compileFilterList renders a sorted, deduplicated domain list as both a
+// hosts-file body (for ZEROIP blocking) and a single alternation regex (for
+// NXDOMAIN/REFUSED blocking), and hashes the input so callers can detect a
+// no-op refresh and skip a mid-flight ConfigMap update.
+func compileFilterList(domains []string) (hostsBody, regexBody, hash string) {
+	var hosts strings.Builder
+	var alternatives []string
+	for _, domain := range domains {
+		fmt.Fprintf(&hosts, "0.0.0.0 %s\n", domain)
+		alternatives = append(alternatives, regexp.QuoteMeta(domain))
+	}
+	if len(alternatives) > 0 {
+		regexBody = fmt.Sprintf("(^|\\.)(%s)\\.$", strings.Join(alternatives, "|"))
+	}
+
+	sum := sha256.Sum256([]byte(hosts.String()))
+	return hosts.String(), regexBody, hex.EncodeToString(sum[:])
+}
+
+func normalizeFilterDomain(domain string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+}
+
+// fetchFilterSource resolves a single filter source into a flat list of
+// normalized domains, regardless of whether it was supplied inline, via a
+// ConfigMap reference, or fetched from a URL.
+func (r *reconciler) fetchFilterSource(source operatorv1.FilterSource) ([]string, error) {
+	var body string
+	switch source.Type {
+	case operatorv1.InlineFilterSourceType:
+		body = strings.Join(source.Inline, "\n")
+	case operatorv1.ConfigMapFilterSourceType:
+		cm := &corev1.ConfigMap{}
+		if err := r.client.Get(context.TODO(), types.NamespacedName{Namespace: source.ConfigMapRef.Namespace, Name: source.ConfigMapRef.Name}, cm); err != nil {
+			return nil, err
+		}
+		body = cm.Data[source.ConfigMapRef.Key]
+	case operatorv1.URLFilterSourceType:
+		resp, err := http.Get(source.URL)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %d fetching %s", resp.StatusCode, source.URL)
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxFilterListSourceBytes))
+		if err != nil {
+			return nil, err
+		}
+		body = string(data)
+	default:
+		return nil, fmt.Errorf("unsupported filter source type %q", source.Type)
+	}
+
+	return parseFilterListBody(source.Format, body)
+}
+
+// parseFilterListBody extracts domains from a source body according to its
+// declared format.
+func parseFilterListBody(format operatorv1.FilterSourceFormat, body string) ([]string, error) {
+	var domains []string
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+		switch format {
+		case operatorv1.HostsFilterSourceFormat:
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				continue
+			}
+			domains = append(domains, normalizeFilterDomain(fields[len(fields)-1]))
+		case operatorv1.AdBlockPlusFilterSourceFormat:
+			if !strings.HasPrefix(line, "||") {
+				continue
+			}
+			line = strings.TrimPrefix(line, "||")
+			if idx := strings.IndexAny(line, "^/"); idx >= 0 {
+				line = line[:idx]
+			}
+			domains = append(domains, normalizeFilterDomain(line))
+		case operatorv1.DomainsOnlyFilterSourceFormat, "":
+			domains = append(domains, normalizeFilterDomain(line))
+		default:
+			return nil, fmt.Errorf("unsupported filter source format %q", format)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return domains, nil
+}
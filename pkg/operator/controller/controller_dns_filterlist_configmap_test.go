@@ -0,0 +1,198 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestCoreDNSFilteringBlock covers every BlockResponse mode, including the
+// "no sources yet" and "regex not compiled yet" cases that must render
+// nothing rather than a block CoreDNS would reject.
+func TestCoreDNSFilteringBlock(t *testing.T) {
+	oneSource := []operatorv1.FilterSource{{Name: "blocklist", Type: operatorv1.InlineFilterSourceType}}
+
+	tests := []struct {
+		name       string
+		filtering  operatorv1.DNSFiltering
+		hostsPath  string
+		matchRegex string
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:      "disabled filtering renders nothing",
+			filtering: operatorv1.DNSFiltering{Enabled: false, Sources: oneSource},
+			want:      "",
+		},
+		{
+			name:      "enabled with no sources renders nothing",
+			filtering: operatorv1.DNSFiltering{Enabled: true},
+			want:      "",
+		},
+		{
+			name:      "default block response is ZEROIP via the hosts plugin",
+			filtering: operatorv1.DNSFiltering{Enabled: true, Sources: oneSource},
+			hostsPath: filterListHostsMountPath,
+			want:      "hosts " + filterListHostsMountPath + " {\n        fallthrough\n    }",
+		},
+		{
+			name:      "explicit ZEROIP is the same as the default",
+			filtering: operatorv1.DNSFiltering{Enabled: true, Sources: oneSource, BlockResponse: operatorv1.FilteringBlockResponseZeroIP},
+			hostsPath: filterListHostsMountPath,
+			want:      "hosts " + filterListHostsMountPath + " {\n        fallthrough\n    }",
+		},
+		{
+			name:       "NXDOMAIN renders a template plugin against the match regex",
+			filtering:  operatorv1.DNSFiltering{Enabled: true, Sources: oneSource, BlockResponse: operatorv1.FilteringBlockResponseNXDOMAIN},
+			matchRegex: "(^|\\.)(ads\\.example\\.com)\\.$",
+			want:       "template IN ANY {\n        match (^|\\.)(ads\\.example\\.com)\\.$\n        rcode NXDOMAIN\n        fallthrough\n    }",
+		},
+		{
+			name:       "REFUSED renders the same template plugin with rcode REFUSED",
+			filtering:  operatorv1.DNSFiltering{Enabled: true, Sources: oneSource, BlockResponse: operatorv1.FilteringBlockResponseRefused},
+			matchRegex: "(^|\\.)(ads\\.example\\.com)\\.$",
+			want:       "template IN ANY {\n        match (^|\\.)(ads\\.example\\.com)\\.$\n        rcode REFUSED\n        fallthrough\n    }",
+		},
+		{
+			name:      "NXDOMAIN with no regex yet renders nothing",
+			filtering: operatorv1.DNSFiltering{Enabled: true, Sources: oneSource, BlockResponse: operatorv1.FilteringBlockResponseNXDOMAIN},
+			want:      "",
+		},
+		{
+			name:      "unsupported block response is an error",
+			filtering: operatorv1.DNSFiltering{Enabled: true, Sources: oneSource, BlockResponse: "bogus"},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := coreDNSFilteringBlock(tt.filtering, tt.hostsPath, tt.matchRegex)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("coreDNSFilteringBlock() expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("coreDNSFilteringBlock() returned unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("coreDNSFilteringBlock() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseFilterListBody covers each FilterSourceFormat the reconciler
+// accepts from an inline, ConfigMap, or URL source.
+func TestParseFilterListBody(t *testing.T) {
+	tests := []struct {
+		name   string
+		format operatorv1.FilterSourceFormat
+		body   string
+		want   []string
+	}{
+		{
+			name:   "domains-only format, comments and blank lines skipped",
+			format: operatorv1.DomainsOnlyFilterSourceFormat,
+			body:   "ads.example.com\n# comment\n\ntracker.example.com\n",
+			want:   []string{"ads.example.com", "tracker.example.com"},
+		},
+		{
+			name:   "empty format defaults to domains-only",
+			format: "",
+			body:   "ads.example.com\n",
+			want:   []string{"ads.example.com"},
+		},
+		{
+			name:   "hosts format keeps the last field on each line",
+			format: operatorv1.HostsFilterSourceFormat,
+			body:   "0.0.0.0 ads.example.com\n127.0.0.1 tracker.example.com\nmalformed-line\n",
+			want:   []string{"ads.example.com", "tracker.example.com"},
+		},
+		{
+			name:   "adblock-plus format strips || and trailing ^ or /",
+			format: operatorv1.AdBlockPlusFilterSourceFormat,
+			body:   "||ads.example.com^\n||tracker.example.com/path\nignored.example.com\n! comment\n",
+			want:   []string{"ads.example.com", "tracker.example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseFilterListBody(tt.format, tt.body)
+			if err != nil {
+				t.Fatalf("parseFilterListBody() returned unexpected error: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseFilterListBody() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("parseFilterListBody()[%d] = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+
+	if _, err := parseFilterListBody("bogus", "x\n"); err == nil {
+		t.Errorf("parseFilterListBody() with an unsupported format, want an error")
+	}
+}
+
+// TestCompileFilterList verifies the hosts body and match regex derived from
+// a domain list, and that an empty list yields an empty regex rather than a
+// regex that matches everything.
+func TestCompileFilterList(t *testing.T) {
+	hosts, regex, hash := compileFilterList([]string{"ads.example.com", "tracker.example.com"})
+	wantHosts := "0.0.0.0 ads.example.com\n0.0.0.0 tracker.example.com\n"
+	if hosts != wantHosts {
+		t.Errorf("compileFilterList() hosts = %q, want %q", hosts, wantHosts)
+	}
+	wantRegex := "(^|\\.)(ads\\.example\\.com|tracker\\.example\\.com)\\.$"
+	if regex != wantRegex {
+		t.Errorf("compileFilterList() regex = %q, want %q", regex, wantRegex)
+	}
+	if hash == "" {
+		t.Errorf("compileFilterList() hash = %q, want a non-empty hash", hash)
+	}
+
+	emptyHosts, emptyRegex, emptyHash := compileFilterList(nil)
+	if emptyHosts != "" || emptyRegex != "" {
+		t.Errorf("compileFilterList(nil) = (%q, %q), want both empty", emptyHosts, emptyRegex)
+	}
+	if emptyHash == hash {
+		t.Errorf("compileFilterList(nil) hash should differ from a non-empty list's hash")
+	}
+}
+
+func TestNormalizeFilterDomain(t *testing.T) {
+	tests := map[string]string{
+		"Ads.Example.Com.": "ads.example.com",
+		"  tracker.com  ":  "tracker.com",
+		"already.lower":    "already.lower",
+	}
+	for in, want := range tests {
+		if got := normalizeFilterDomain(in); got != want {
+			t.Errorf("normalizeFilterDomain(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// TestFilterListRefreshInterval verifies the default refresh cadence and
+// that an explicit Spec.Filtering.RefreshIntervalSeconds overrides it.
+func TestFilterListRefreshInterval(t *testing.T) {
+	dns := &operatorv1.DNS{ObjectMeta: metav1.ObjectMeta{Name: "default"}}
+	if got := filterListRefreshInterval(dns); got != defaultFilterListRefreshInterval {
+		t.Errorf("filterListRefreshInterval() = %v, want default %v", got, defaultFilterListRefreshInterval)
+	}
+
+	dns.Spec.Filtering.RefreshIntervalSeconds = 120
+	if got := filterListRefreshInterval(dns); got != 120*time.Second {
+		t.Errorf("filterListRefreshInterval() = %v, want %v", got, 120*time.Second)
+	}
+}